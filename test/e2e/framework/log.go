@@ -19,12 +19,15 @@ package framework
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"reflect"
 	"regexp"
 	"runtime"
-	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/onsi/ginkgo/v2"
+	"k8s.io/kubernetes/test/e2e/framework/stackdump"
 	// TODO: Remove the following imports (ref: https://github.com/kubernetes/kubernetes/issues/81245)
 )
 
@@ -33,7 +36,7 @@ func nowStamp() string {
 }
 
 func log(level string, format string, args ...interface{}) {
-	fmt.Fprintf(ginkgo.GinkgoWriter, nowStamp()+": "+level+": "+format+"\n", args...)
+	dispatch(level, time.Now(), fmt.Sprintf(format, args...))
 }
 
 // Logf logs the info.
@@ -41,16 +44,51 @@ func Logf(format string, args ...interface{}) {
 	log("INFO", format, args...)
 }
 
+// Logw is the structured counterpart to Logf: it delivers msg and
+// keysAndValues to every registered LogSink instead of formatting them into
+// a single string, so sinks that understand structure (LogrSink,
+// NewJSONLinesSink) can index the fields directly.
+func Logw(msg string, keysAndValues ...interface{}) {
+	dispatch("INFO", time.Now(), msg, keysAndValues...)
+}
+
 // Failf logs the fail info, including a stack trace starts with its direct caller
 // (for example, for call chain f -> g -> Failf("foo", ...) error would be logged for "g").
 func Failf(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
 	skip := 1
-	log("FAIL", "%s\n\nFull Stack Trace\n%s", msg, PrunedStack(skip))
+	stack := PrunedStack(skip)
+	location := CallerLocation(skip)
+	kv := []interface{}{"stack", string(stack), "file", location.File, "line", location.Line}
+	if report := ginkgo.CurrentSpecReport(); report.LeafNodeText != "" {
+		kv = append(kv, "spec", report.FullText(), "labels", report.Labels())
+	}
+	dispatch("FAIL", time.Now(), msg, kv...)
+	logGoroutines()
 	fail(nowStamp()+": "+msg, skip)
 	panic("unreachable")
 }
 
+// logGoroutines logs a densified snapshot of all goroutines below the
+// failing caller's pruned stack, gated behind E2E_DUMP_GOROUTINES=1 because
+// it is expensive and only useful when chasing a hang or a goroutine leak.
+func logGoroutines() {
+	if os.Getenv("E2E_DUMP_GOROUTINES") != "1" {
+		return
+	}
+	snapshot, err := stackdump.Capture()
+	if err != nil {
+		log("FAIL", "failed to capture goroutine dump: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := snapshot.WriteText(&buf); err != nil {
+		log("FAIL", "failed to render goroutine dump: %v", err)
+		return
+	}
+	log("FAIL", "All goroutines:\n%s", buf.String())
+}
+
 // Fail is a replacement for ginkgo.Fail which logs the problem as it occurs
 // together with a stack trace and then calls ginkgowrapper.Fail.
 func Fail(msg string, callerSkip ...int) {
@@ -58,16 +96,25 @@ func Fail(msg string, callerSkip ...int) {
 	if len(callerSkip) > 0 {
 		skip += callerSkip[0]
 	}
-	log("FAIL", "%s\n\nFull Stack Trace\n%s", msg, PrunedStack(skip))
+	stack := PrunedStack(skip)
+	location := CallerLocation(skip)
+	kv := []interface{}{"stack", string(stack), "file", location.File, "line", location.Line}
+	if report := ginkgo.CurrentSpecReport(); report.LeafNodeText != "" {
+		kv = append(kv, "spec", report.FullText(), "labels", report.Labels())
+	}
+	dispatch("FAIL", time.Now(), msg, kv...)
 	fail(nowStamp()+": "+msg, skip)
 }
 
 // FailurePanic is the value that will be panicked from Fail.
 type FailurePanic struct {
-	Message        string // The failure message passed to Fail
-	Filename       string // The filename that is the source of the failure
-	Line           int    // The line number of the filename that is the source of the failure
-	FullStackTrace string // A full stack trace starting at the source of the failure
+	Message        string       // The failure message passed to Fail
+	Filename       string       // The filename that is the source of the failure
+	Line           int          // The line number of the filename that is the source of the failure
+	Location       CodeLocation // Structured location of the failure, with the helper frames already skipped
+	Kind           FailureKind  // The inferred root cause of the failure
+	FullStackTrace string       // The current goroutine's stack trace
+	PreviousStack  string       // The "previous access" stack of a data race report, if Kind == KindDataRace and one was found
 }
 
 const ginkgoFailurePanic = `
@@ -92,12 +139,32 @@ func fail(message string, callerSkip ...int) {
 		skip += callerSkip[0]
 	}
 
-	_, file, line, _ := runtime.Caller(skip)
+	location := CallerLocation(skip)
+	stack := PrunedStack(skip)
+	kind := ClassifyStack(stack)
+	current, previous := stack, []byte(nil)
+	// ClassifyStack and splitRaceReport look for "goroutine N [...]:"
+	// headers and "Previous write/read at" blocks, neither of which the
+	// current goroutine's own PrunedStack ever contains; getting those
+	// requires a full runtime.Stack(all=true)-style dump of every
+	// goroutine in the binary, which is too expensive to take on every
+	// single assertion failure, so deadlock/race classification is only
+	// attempted under the same E2E_DUMP_GOROUTINES=1 gate as logGoroutines.
+	if os.Getenv("E2E_DUMP_GOROUTINES") == "1" {
+		dump := allGoroutinesDump()
+		kind = ClassifyStack(dump)
+		if kind == KindDataRace {
+			current, previous = splitRaceReport(dump)
+		}
+	}
 	fp := FailurePanic{
 		Message:        message,
-		Filename:       file,
-		Line:           line,
-		FullStackTrace: string(PrunedStack(skip)),
+		Filename:       location.File,
+		Line:           location.Line,
+		Location:       location,
+		Kind:           kind,
+		FullStackTrace: string(current),
+		PreviousStack:  string(previous),
 	}
 
 	defer func() {
@@ -112,43 +179,269 @@ func fail(message string, callerSkip ...int) {
 
 var codeFilterRE = regexp.MustCompile(`/github.com/onsi/ginkgo/v2/`)
 
-// PrunedStack is a wrapper around debug.Stack() that removes information
-// about the current goroutine and optionally skips some of the initial stack entries.
-// With skip == 0, the returned stack will start with the caller of PruneStack.
-// From the remaining entries it automatically filters out useless ones like
-// entries coming from Ginkgo.
+var (
+	helperFuncsMu sync.Mutex
+	helperFuncs   = map[string]bool{}
+)
+
+// RegisterHelper marks fn as a test helper, similar to testing.T.Helper or
+// ginkgo's gomega.RegisterFailHandler plumbing. Frames belonging to
+// functions registered this way are skipped when computing the failure
+// location and when pruning a stack trace, so that wrapper functions such
+// as custom gomega.Expect helpers, retry loops, or ExpectNoError report the
+// line of their caller instead of their own body.
+//
+// fn must be a function value, e.g. RegisterHelper(ExpectNoError).
+func RegisterHelper(fn interface{}) {
+	name := funcName(fn)
+	if name == "" {
+		return
+	}
+	helperFuncsMu.Lock()
+	defer helperFuncsMu.Unlock()
+	helperFuncs[name] = true
+}
+
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+	return f.Name()
+}
+
+func isHelper(name string) bool {
+	helperFuncsMu.Lock()
+	defer helperFuncsMu.Unlock()
+	return helperFuncs[name]
+}
+
+// CodeLocation is a structured description of a source code location, as
+// produced by CallerLocation. It mirrors the CodeLocation type that
+// ginkgo/v2 attaches to specs and failures.
+type CodeLocation struct {
+	File           string // The filename of the source of the failure
+	Line           int    // The line number of the filename that is the source of the failure
+	Func           string // The fully qualified name of the function at File:Line
+	ContentsOfLine string // The contents of File at Line, if the file could be read
+}
+
+// CallerLocation walks the call stack, skipping the given number of frames
+// plus any frames belonging to functions registered with RegisterHelper,
+// and returns a CodeLocation describing the resulting caller. This gives
+// Fail/Failf an accurate blame line even when they are invoked through
+// arbitrary layers of assertion wrappers.
+func CallerLocation(skip int) CodeLocation {
+	// The "+2" is for skipping over CallerLocation itself and the
+	// runtime.Callers call below.
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip+2, pcs)
+		if n < len(pcs) || n == 0 {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, len(pcs)*2)
+	}
+
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !isHelper(frame.Function) {
+			return CodeLocation{
+				File:           frame.File,
+				Line:           frame.Line,
+				Func:           frame.Function,
+				ContentsOfLine: readSourceLine(frame.File, frame.Line),
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return CodeLocation{}
+}
+
+func readSourceLine(file string, line int) string {
+	if file == "" || line <= 0 {
+		return ""
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	if line > len(lines) {
+		return ""
+	}
+	return string(bytes.TrimRight(lines[line-1], "\r"))
+}
+
+// PrunedStack returns the current goroutine's stack, optionally skipping
+// some of the initial stack entries. With skip == 0, the returned stack
+// will start with the caller of PrunedStack. From the remaining entries it
+// automatically filters out useless ones like entries coming from Ginkgo
+// or from functions registered with RegisterHelper.
 //
-// This is a modified copy of PruneStack in https://github.com/onsi/ginkgo/v2/blob/f90f37d87fa6b1dd9625e2b1e83c23ffae3de228/internal/codelocation/code_location.go#L25:
-//   - simplified API and thus renamed (calls debug.Stack() instead of taking a parameter)
+// This is based on PruneStack in https://github.com/onsi/ginkgo/v2/blob/f90f37d87fa6b1dd9625e2b1e83c23ffae3de228/internal/codelocation/code_location.go#L25,
+// but walks runtime.Callers instead of parsing the text of debug.Stack() so
+// that helper frames can be identified and skipped by function name:
+//   - simplified API and thus renamed
 //   - source code filtering updated to be specific to Kubernetes
-//   - optimized to use bytes and in-place slice filtering from
-//     https://github.com/golang/go/wiki/SliceTricks#filter-in-place
+//   - helper-aware: frames registered via RegisterHelper are skipped
 func PrunedStack(skip int) []byte {
-	fullStackTrace := debug.Stack()
-	stack := bytes.Split(fullStackTrace, []byte("\n"))
-	// Ensure that the even entries are the method names and
-	// the odd entries the source code information.
-	if len(stack) > 0 && bytes.HasPrefix(stack[0], []byte("goroutine ")) {
-		// Ignore "goroutine 29 [running]:" line.
-		stack = stack[1:]
-	}
 	// The "+2" is for skipping over:
-	// - runtime/debug.Stack()
+	// - runtime.Callers()
 	// - PrunedStack()
-	skip += 2
-	if len(stack) > 2*skip {
-		stack = stack[2*skip:]
-	}
-	n := 0
-	for i := 0; i < len(stack)/2; i++ {
-		// We filter out based on the source code file name.
-		if !codeFilterRE.Match([]byte(stack[i*2+1])) {
-			stack[n] = stack[i*2]
-			stack[n+1] = stack[i*2+1]
-			n += 2
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip+2, pcs)
+		if n < len(pcs) || n == 0 {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, len(pcs)*2)
+	}
+
+	var callFrames []runtime.Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		callFrames = append(callFrames, frame)
+		if !more {
+			break
 		}
 	}
-	stack = stack[:n]
 
-	return bytes.Join(stack, []byte("\n"))
+	var buf bytes.Buffer
+	for _, frame := range callFrames {
+		if codeFilterRE.MatchString(frame.File) || isHelper(frame.Function) {
+			continue
+		}
+		// Frames coming from the race detector's own instrumentation
+		// (runtime.raceread/racewrite/...) are never pruned: on the rare
+		// occasion they show up in the current goroutine's own call stack,
+		// their presence is itself the whole point of a data race report.
+		fmt.Fprintf(&buf, "%s()\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+	}
+
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// allGoroutinesDump returns a raw dump of every goroutine in the same
+// "goroutine N [state]:" text format that runtime.Stack(all=true) produces
+// and stackdump.Parse reads. Unlike PrunedStack, which only ever sees the current
+// goroutine's own frames, this is what ClassifyStack and splitRaceReport
+// need to recognize a hang (every goroutine blocked) or a race report
+// (a "Previous write/read at" block).
+func allGoroutinesDump() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+// FailureKind categorizes the underlying cause of a test failure, inferred
+// from the content of its stack trace. Downstream junit/reporter tooling
+// can group flakes by FailureKind instead of by test name, since the same
+// deadlock or data race often manifests as failures in many different
+// tests.
+type FailureKind int
+
+const (
+	// KindAssertion is a plain ginkgo/gomega assertion failure; the default
+	// when nothing more specific is detected.
+	KindAssertion FailureKind = iota
+	// KindPanic is an unrecovered panic unrelated to an assertion.
+	KindPanic
+	// KindDataRace was flagged by the race detector (`go test -race`).
+	KindDataRace
+	// KindTimeout is a context deadline or Eventually/Consistently timeout.
+	KindTimeout
+	// KindDeadlock is "all goroutines are asleep - deadlock!", or every
+	// goroutine in the dump blocked on a channel, select, sync.Mutex or
+	// sync.WaitGroup operation.
+	KindDeadlock
+)
+
+// String returns the human-readable name used in log output and by
+// reporters that group failures by kind.
+func (k FailureKind) String() string {
+	switch k {
+	case KindPanic:
+		return "Panic"
+	case KindDataRace:
+		return "DataRace"
+	case KindTimeout:
+		return "Timeout"
+	case KindDeadlock:
+		return "Deadlock"
+	default:
+		return "Assertion"
+	}
+}
+
+var (
+	raceInternalFuncRE = regexp.MustCompile(`(?m)^runtime\.race(read|write|acquire|release)`)
+	raceReportHeaderRE = regexp.MustCompile(`WARNING: DATA RACE`)
+	deadlockRE         = regexp.MustCompile(`all goroutines are asleep - deadlock!`)
+	timeoutRE          = regexp.MustCompile(`context deadline exceeded|i/o timeout|timed out after`)
+	blockedGoroutineRE = regexp.MustCompile(`(?m)^goroutine \d+ \[(chan receive|chan send|select|sync\.(Mutex|WaitGroup))`)
+)
+
+// ClassifyStack inspects the text of a stack trace or goroutine dump (as
+// produced by PrunedStack, runtime.Stack, or a captured "go test -race" report)
+// and returns its best-guess FailureKind.
+func ClassifyStack(stack []byte) FailureKind {
+	switch {
+	case raceReportHeaderRE.Match(stack) || raceInternalFuncRE.Match(stack):
+		return KindDataRace
+	case deadlockRE.Match(stack):
+		return KindDeadlock
+	case timeoutRE.Match(stack):
+		return KindTimeout
+	case isAllGoroutinesBlocked(stack):
+		return KindDeadlock
+	}
+	return KindAssertion
+}
+
+// isAllGoroutinesBlocked reports whether stack contains at least one
+// "goroutine N [...]:" header and every one of them is in a blocking state
+// (chan/select/mutex/waitgroup), which is the signature of a hang that the
+// race detector or runtime didn't itself label as a deadlock.
+func isAllGoroutinesBlocked(stack []byte) bool {
+	headers := goroutineHeaderRE.FindAll(stack, -1)
+	if len(headers) == 0 {
+		return false
+	}
+	blocked := blockedGoroutineRE.FindAll(stack, -1)
+	return len(blocked) == len(headers)
+}
+
+var goroutineHeaderRE = regexp.MustCompile(`(?m)^goroutine \d+ \[[^\]]+\]:`)
+
+// splitRaceReport splits the text of a "go test -race" DATA RACE report
+// into its current-access and previous-access stacks. Preserving both
+// halves, rather than pruning the "Previous ..." block as noise, is the
+// whole point of a race report: it takes both stacks to find the bug.
+// Stacks that are not a race report are returned unchanged as current,
+// with a nil previous.
+func splitRaceReport(stack []byte) (current, previous []byte) {
+	idx := bytes.Index(stack, []byte("Previous write at"))
+	if idx < 0 {
+		idx = bytes.Index(stack, []byte("Previous read at"))
+	}
+	if idx < 0 {
+		return stack, nil
+	}
+	return stack[:idx], stack[idx:]
 }
@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import "testing"
+
+func callerLocationTestHelper() CodeLocation {
+	return CallerLocation(0)
+}
+
+func TestCallerLocationSkipsRegisteredHelper(t *testing.T) {
+	helperName := funcName(callerLocationTestHelper)
+
+	// Before registration, CallerLocation(0) called from inside the helper
+	// reports the helper's own frame.
+	if got := callerLocationTestHelper(); got.Func != helperName {
+		t.Fatalf("expected unregistered helper frame %q, got %q", helperName, got.Func)
+	}
+
+	RegisterHelper(callerLocationTestHelper)
+	defer func() {
+		helperFuncsMu.Lock()
+		delete(helperFuncs, helperName)
+		helperFuncsMu.Unlock()
+	}()
+
+	// Once registered, the helper's own frame is skipped and the caller
+	// (this test function) is reported instead.
+	if got := callerLocationTestHelper(); got.Func != funcName(TestCallerLocationSkipsRegisteredHelper) {
+		t.Errorf("expected CallerLocation to skip the registered helper frame and report %q, got %q",
+			funcName(TestCallerLocationSkipsRegisteredHelper), got.Func)
+	}
+}
+
+func TestIsHelper(t *testing.T) {
+	name := funcName(callerLocationTestHelper)
+	if isHelper(name) {
+		t.Fatalf("expected %q to not be a helper before RegisterHelper is called", name)
+	}
+	RegisterHelper(callerLocationTestHelper)
+	defer func() {
+		helperFuncsMu.Lock()
+		delete(helperFuncs, name)
+		helperFuncsMu.Unlock()
+	}()
+	if !isHelper(name) {
+		t.Fatalf("expected %q to be a helper after RegisterHelper", name)
+	}
+}
+
+func TestFuncNameRejectsNonFunc(t *testing.T) {
+	if got := funcName("not a func"); got != "" {
+		t.Errorf("expected empty name for a non-func value, got %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"testing"
+)
+
+func TestClassifyStack(t *testing.T) {
+	cases := []struct {
+		name  string
+		stack string
+		want  FailureKind
+	}{
+		{
+			name:  "plain assertion",
+			stack: "k8s.io/kubernetes/test/e2e/framework.ExpectNoError()\n\t/go/src/.../log.go:1",
+			want:  KindAssertion,
+		},
+		{
+			name:  "timeout",
+			stack: "Expected success, but got an error: <*errors.errorString | 0x0>: context deadline exceeded",
+			want:  KindTimeout,
+		},
+		{
+			name: "deadlock header",
+			stack: "fatal error: all goroutines are asleep - deadlock!\n\n" +
+				"goroutine 1 [chan receive]:\nmain.main()\n\t/go/src/.../main.go:1",
+			want: KindDeadlock,
+		},
+		{
+			name: "every goroutine blocked without an explicit deadlock header",
+			stack: "goroutine 1 [chan receive]:\nmain.main()\n\t/go/src/.../main.go:1\n\n" +
+				"goroutine 7 [select]:\nk8s.io/kubernetes/test/e2e/framework.Eventually()\n\t/go/src/.../expect.go:1",
+			want: KindDeadlock,
+		},
+		{
+			name: "not every goroutine blocked",
+			stack: "goroutine 1 [chan receive]:\nmain.main()\n\t/go/src/.../main.go:1\n\n" +
+				"goroutine 7 [running]:\nk8s.io/kubernetes/test/e2e/framework.Eventually()\n\t/go/src/.../expect.go:1",
+			want: KindAssertion,
+		},
+		{
+			name: "data race report",
+			stack: "WARNING: DATA RACE\nWrite at 0x00c0001a2000 by goroutine 7:\n" +
+				"  main.inc()\n\t/go/src/.../main.go:10\n\n" +
+				"Previous write at 0x00c0001a2000 by goroutine 8:\n" +
+				"  main.inc()\n\t/go/src/.../main.go:10\n",
+			want: KindDataRace,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ClassifyStack([]byte(c.stack)); got != c.want {
+				t.Errorf("ClassifyStack(%q) = %v, want %v", c.name, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSplitRaceReport(t *testing.T) {
+	stack := "WARNING: DATA RACE\nWrite at 0x00c0001a2000 by goroutine 7:\n" +
+		"  main.inc()\n\t/go/src/.../main.go:10\n\n" +
+		"Previous write at 0x00c0001a2000 by goroutine 8:\n" +
+		"  main.inc()\n\t/go/src/.../main.go:10\n"
+
+	current, previous := splitRaceReport([]byte(stack))
+	if want := "WARNING: DATA RACE\nWrite at 0x00c0001a2000 by goroutine 7:\n  main.inc()\n\t/go/src/.../main.go:10\n\n"; string(current) != want {
+		t.Errorf("current = %q, want %q", current, want)
+	}
+	if want := "Previous write at 0x00c0001a2000 by goroutine 8:\n  main.inc()\n\t/go/src/.../main.go:10\n"; string(previous) != want {
+		t.Errorf("previous = %q, want %q", previous, want)
+	}
+}
+
+func TestSplitRaceReportNoPreviousAccess(t *testing.T) {
+	stack := "k8s.io/kubernetes/test/e2e/framework.ExpectNoError()\n\t/go/src/.../log.go:1"
+	current, previous := splitRaceReport([]byte(stack))
+	if string(current) != stack {
+		t.Errorf("current = %q, want the stack unchanged %q", current, stack)
+	}
+	if previous != nil {
+		t.Errorf("expected a nil previous stack, got %q", previous)
+	}
+}
+
+func TestIsAllGoroutinesBlocked(t *testing.T) {
+	if isAllGoroutinesBlocked([]byte("no goroutine headers here")) {
+		t.Errorf("expected false when there are no goroutine headers")
+	}
+	allBlocked := "goroutine 1 [chan receive]:\nmain.main()\n\t/go/src/.../main.go:1\n\n" +
+		"goroutine 2 [select]:\nmain.other()\n\t/go/src/.../main.go:2"
+	if !isAllGoroutinesBlocked([]byte(allBlocked)) {
+		t.Errorf("expected true when every goroutine is in a blocking state")
+	}
+	notAllBlocked := "goroutine 1 [chan receive]:\nmain.main()\n\t/go/src/.../main.go:1\n\n" +
+		"goroutine 2 [running]:\nmain.other()\n\t/go/src/.../main.go:2"
+	if isAllGoroutinesBlocked([]byte(notAllBlocked)) {
+		t.Errorf("expected false when at least one goroutine is running")
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/ginkgo/v2"
+)
+
+// LogSink receives every message logged through Logf, Logw and Failf.
+// keysAndValues follows the same even-length, alternating-key/value
+// convention as logr.Logger.Info, and is nil for plain Logf calls that
+// carry no structured fields. Failf always passes "stack", "file" and
+// "line" (plus "spec" and "labels" inside a running spec).
+//
+// Implementations must be safe for concurrent use, since e2e tests log
+// from many goroutines at once.
+type LogSink interface {
+	Log(level string, ts time.Time, msg string, keysAndValues ...interface{})
+}
+
+var (
+	sinksMu sync.RWMutex
+	sinks   = []LogSink{ginkgoWriterSink{}}
+)
+
+// AddSink registers an additional LogSink. Every subsequent Logf, Logw and
+// Failf call is delivered to it alongside the sinks already registered.
+func AddSink(sink LogSink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// SetSinks replaces the full set of registered sinks, e.g. to drop the
+// default GinkgoWriter sink in favor of a structured one.
+func SetSinks(newSinks ...LogSink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks = append([]LogSink{}, newSinks...)
+}
+
+func dispatch(level string, ts time.Time, msg string, keysAndValues ...interface{}) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, sink := range sinks {
+		sink.Log(level, ts, msg, keysAndValues...)
+	}
+}
+
+// ginkgoWriterSink is the default LogSink and preserves the traditional
+// "<timestamp>: <LEVEL>: <msg>" formatting that Logf/Failf have always
+// written to ginkgo.GinkgoWriter. A "stack" key/value pair, if present, is
+// rendered as a trailing "Full Stack Trace" block instead of inline JSON.
+type ginkgoWriterSink struct{}
+
+func (ginkgoWriterSink) Log(level string, ts time.Time, msg string, keysAndValues ...interface{}) {
+	fmt.Fprintln(ginkgo.GinkgoWriter, formatGinkgoWriterLine(level, ts, msg, keysAndValues...))
+}
+
+// formatGinkgoWriterLine renders a single log line in ginkgoWriterSink's
+// traditional format. It is split out from Log so it can be tested without
+// going through the global ginkgo.GinkgoWriter.
+func formatGinkgoWriterLine(level string, ts time.Time, msg string, keysAndValues ...interface{}) string {
+	line := ts.Format(time.StampMilli) + ": " + level + ": " + msg
+	kv := keysAndValuesToMap(keysAndValues)
+	stack, hasStack := kv["stack"].(string)
+	delete(kv, "stack")
+	// The remaining fields (file, line, spec, labels, ...) get their own
+	// line so they never run into the last line of a free-text stack trace
+	// appended below.
+	if len(kv) > 0 {
+		line += fmt.Sprintf("\n%v", kv)
+	}
+	if hasStack && stack != "" {
+		line += "\n\nFull Stack Trace\n" + stack
+	}
+	return line
+}
+
+// LogrSink adapts a logr.Logger into a LogSink, so structured e2e log
+// statements also flow through whatever logr backend the test binary was
+// started with (klog, zap, ...), rather than only ever landing in
+// GinkgoWriter.
+type LogrSink struct {
+	Logger logr.Logger
+}
+
+// Log implements LogSink.
+func (s LogrSink) Log(level string, _ time.Time, msg string, keysAndValues ...interface{}) {
+	if level == "FAIL" {
+		s.Logger.Error(nil, msg, keysAndValues...)
+		return
+	}
+	s.Logger.Info(msg, keysAndValues...)
+}
+
+// NewJSONLinesSink returns a LogSink that writes each log statement to w as
+// a single JSON object followed by a newline, so CI systems can ingest
+// per-test structured logs without scraping free-form text.
+func NewJSONLinesSink(w io.Writer) LogSink {
+	return &jsonLinesSink{w: w}
+}
+
+type jsonLinesSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type jsonLogLine struct {
+	Time  time.Time              `json:"time"`
+	Level string                 `json:"level"`
+	Msg   string                 `json:"msg"`
+	KV    map[string]interface{} `json:"kv,omitempty"`
+}
+
+// Log implements LogSink.
+func (s *jsonLinesSink) Log(level string, ts time.Time, msg string, keysAndValues ...interface{}) {
+	data, err := json.Marshal(jsonLogLine{Time: ts, Level: level, Msg: msg, KV: keysAndValuesToMap(keysAndValues)})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(data)
+}
+
+func keysAndValuesToMap(keysAndValues []interface{}) map[string]interface{} {
+	if len(keysAndValues) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(keysAndValues)/2)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		m[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+	}
+	return m
+}
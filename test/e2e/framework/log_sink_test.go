@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatGinkgoWriterLineStackDoesNotSwallowOtherFields(t *testing.T) {
+	ts := time.Now()
+	line := formatGinkgoWriterLine("FAIL", ts, "boom",
+		"stack", "func()\n\tfile.go:1", "file", "foo_test.go", "line", 42, "spec", "does a thing", "labels", []string{"slow"})
+
+	lines := strings.Split(line, "\n")
+	last := lines[len(lines)-1]
+	if last != "\tfile.go:1" {
+		t.Errorf("expected the stack trace's last line to be untouched by the other kv fields, got %q in:\n%s", last, line)
+	}
+	if !strings.Contains(line, "file:foo_test.go") {
+		t.Errorf("expected the remaining fields to still be rendered somewhere, got:\n%s", line)
+	}
+}
+
+func TestFormatGinkgoWriterLineNoStack(t *testing.T) {
+	line := formatGinkgoWriterLine("INFO", time.Now(), "hello", "key", "value")
+	if strings.Contains(line, "Full Stack Trace") {
+		t.Errorf("expected no stack trace block without a stack key, got:\n%s", line)
+	}
+	if !strings.Contains(line, "map[key:value]") {
+		t.Errorf("expected the kv to be rendered, got:\n%s", line)
+	}
+}
+
+func TestKeysAndValuesToMap(t *testing.T) {
+	if m := keysAndValuesToMap(nil); m != nil {
+		t.Errorf("expected nil for no keysAndValues, got %v", m)
+	}
+	m := keysAndValuesToMap([]interface{}{"a", 1, "b", "two"})
+	if m["a"] != 1 || m["b"] != "two" {
+		t.Errorf("unexpected map: %v", m)
+	}
+}
+
+func TestJSONLinesSinkLog(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesSink(&buf)
+	sink.Log("FAIL", time.Now(), "boom", "stack", "func()\n\tfile.go:1")
+
+	out := buf.String()
+	if !strings.HasSuffix(out, "\n") {
+		t.Fatalf("expected a trailing newline, got %q", out)
+	}
+	if !strings.Contains(out, `"msg":"boom"`) || !strings.Contains(out, `"level":"FAIL"`) {
+		t.Errorf("expected msg/level to be present, got: %s", out)
+	}
+	if !strings.Contains(out, `"stack":"func()`) {
+		t.Errorf("expected the stack to be indexable under its own kv key, got: %s", out)
+	}
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stackdump parses the output of runtime.Stack(buf, true) into
+// structured goroutine records and groups goroutines whose stacks are
+// identical modulo pointer argument values. This turns a dump of
+// thousands of goroutines (common in e2e tests that leak watchers,
+// informers or port-forwards) into a handful of readable lines, similar
+// to what https://github.com/maruel/panicparse does for "go test" output.
+package stackdump
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frame is a single entry in a goroutine's stack trace.
+type Frame struct {
+	Func string // fully qualified function name, e.g. "k8s.io/kubernetes/test/e2e.RunE2ETests"
+	File string
+	Line int
+	Args string // raw argument list as printed by the runtime, e.g. "0xc0001a2000, 0x2540be400"
+
+	// NormalizedArgs is Args with every pointer-looking value (e.g.
+	// "0xc0001a2000") replaced by a "#<n>" placeholder, stable within a
+	// single Snapshot: the same underlying pointer always maps to the same
+	// placeholder, while two different runs of the same dump need not agree
+	// on numbering. This is what makes otherwise-identical frames from
+	// different goroutines compare equal for grouping and display purposes.
+	NormalizedArgs string
+}
+
+// Goroutine is a single parsed goroutine record from a runtime.Stack(all)
+// dump.
+type Goroutine struct {
+	ID        int
+	State     string        // e.g. "running", "chan receive", "IO wait"
+	Wait      time.Duration // how long the goroutine has been in State, 0 if not reported
+	CreatedBy *Frame        // the "created by ..." frame, if present
+	Frames    []Frame
+}
+
+// key returns the dedup key for g: goroutines with the same state and the
+// same sequence of func+file:line frames (ignoring argument values and wait
+// duration) are considered the same for grouping purposes.
+func (g Goroutine) key() string {
+	var b strings.Builder
+	b.WriteString(g.State)
+	for _, f := range g.Frames {
+		fmt.Fprintf(&b, "|%s %s:%d", f.Func, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// isStdlibOnly reports whether every frame in g comes from the Go standard
+// library (no "." in the import path before its last "/", i.e. no import
+// domain; see isStdlibFunc). Such goroutines are typically runtime plumbing (GC,
+// finalizers, signal handling) and are pushed to the bottom of a Snapshot
+// so the interesting, test-specific goroutines are shown first.
+func (g Goroutine) isStdlibOnly() bool {
+	for _, f := range g.Frames {
+		if !isStdlibFunc(f.Func) {
+			return false
+		}
+	}
+	return true
+}
+
+// isStdlibFunc reports whether a fully qualified function name such as
+// "k8s.io/kubernetes/test/e2e/framework.PrunedStack" or
+// "net/http.(*conn).serve" belongs to the standard library. The package
+// name is always the path element right before the separating "." (e.g.
+// "framework" or "http"), so everything up to the last "/" is the import
+// path's directory prefix; stdlib import paths like "net/http" never carry
+// an import domain (a "." in that prefix, e.g. "k8s.io" or "github.com").
+func isStdlibFunc(funcName string) bool {
+	i := strings.LastIndex(funcName, "/")
+	if i < 0 {
+		return true
+	}
+	return !strings.Contains(funcName[:i], ".")
+}
+
+// Group is a set of goroutines that were deduplicated into a single entry
+// because they share the same state and stack shape.
+type Group struct {
+	Goroutines []Goroutine
+	MinWait    time.Duration
+	MaxWait    time.Duration
+}
+
+// Summary returns a compact, single-line description of the group, e.g.
+// "[123 goroutines] chan receive, 4~15 min: k8s.io/kubernetes/test/e2e/framework.Gomega.Eventually".
+func (gr Group) Summary() string {
+	first := gr.Goroutines[0]
+	loc := "???"
+	if len(first.Frames) > 0 {
+		loc = first.Frames[0].Func
+	}
+	wait := ""
+	if gr.MaxWait > 0 {
+		// The runtime reports wait times in whole minutes only.
+		wait = fmt.Sprintf(", %d~%d min", int64(gr.MinWait/time.Minute), int64(gr.MaxWait/time.Minute))
+	}
+	return fmt.Sprintf("[%d goroutines] %s%s: %s", len(gr.Goroutines), first.State, wait, loc)
+}
+
+// Snapshot is a parsed, deduplicated dump of all goroutines at a point in
+// time.
+type Snapshot struct {
+	Groups []Group
+}
+
+// Capture takes a fresh dump of all goroutines via runtime.Stack and
+// returns the parsed, deduplicated result.
+func Capture() (*Snapshot, error) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return Parse(buf[:n])
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+}
+
+var (
+	goroutineHeaderRE = regexp.MustCompile(`^goroutine (\d+) \[([^,\]]+)(?:, (\d+) minutes)?\]:$`)
+	createdByRE       = regexp.MustCompile(`^created by (.+)$`)
+	frameLocationRE   = regexp.MustCompile(`^\s*(.+):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	pointerArgRE      = regexp.MustCompile(`0x[0-9a-f]+`)
+)
+
+// Parse parses the text produced by runtime.Stack(buf, all=true) (the same
+// format used by "go test -race" and an unrecovered panic) into a
+// deduplicated Snapshot.
+//
+// It tolerates the extra "Previous write/read at ..." blocks that the race
+// detector inserts ahead of the goroutine dump by skipping every line before
+// the first "goroutine N [...]:" header, and function-argument lists that
+// wrap onto a following line by folding any line that is neither a header
+// nor a file:line location into the pending function line.
+func Parse(data []byte) (*Snapshot, error) {
+	lines := strings.Split(string(data), "\n")
+
+	var goroutines []Goroutine
+	var cur *Goroutine
+	var pendingFunc string
+	ptrIDs := map[string]int{}
+
+	flushFrame := func(funcLine, locLine string) {
+		if cur == nil || funcLine == "" {
+			return
+		}
+		if m := createdByRE.FindStringSubmatch(funcLine); m != nil {
+			f := parseFrame(m[1], locLine, ptrIDs)
+			cur.CreatedBy = &f
+			return
+		}
+		cur.Frames = append(cur.Frames, parseFrame(funcLine, locLine, ptrIDs))
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if m := goroutineHeaderRE.FindStringSubmatch(line); m != nil {
+			if cur != nil {
+				flushFrame(pendingFunc, "")
+				goroutines = append(goroutines, *cur)
+			}
+			id, _ := strconv.Atoi(m[1])
+			var wait time.Duration
+			if m[3] != "" {
+				minutes, _ := strconv.Atoi(m[3])
+				wait = time.Duration(minutes) * time.Minute
+			}
+			cur = &Goroutine{ID: id, State: m[2], Wait: wait}
+			pendingFunc = ""
+			continue
+		}
+		if cur == nil {
+			// Race detector preamble ("Previous write at ...", "DATA RACE", etc.)
+			// or other noise preceding the first goroutine header.
+			continue
+		}
+		if pendingFunc == "" {
+			pendingFunc = line
+			continue
+		}
+		if frameLocationRE.MatchString(line) {
+			flushFrame(pendingFunc, line)
+			pendingFunc = ""
+			continue
+		}
+		// A continuation of a wrapped argument list: fold it into the
+		// pending function line and keep waiting for the location line.
+		pendingFunc += " " + strings.TrimSpace(line)
+	}
+	if cur != nil {
+		flushFrame(pendingFunc, "")
+		goroutines = append(goroutines, *cur)
+	}
+
+	return &Snapshot{Groups: group(goroutines)}, nil
+}
+
+func parseFrame(funcLine, locLine string, ptrIDs map[string]int) Frame {
+	f := Frame{}
+	// The argument list is the last parenthesized group; method receivers
+	// such as "(*conn)" in "net/http.(*conn).serve(...)" are part of Func.
+	if i := strings.LastIndexByte(funcLine, '('); i >= 0 && strings.HasSuffix(funcLine, ")") {
+		f.Func = funcLine[:i]
+		f.Args = strings.TrimSuffix(funcLine[i:], ")")
+		f.Args = strings.TrimPrefix(f.Args, "(")
+		f.Args = strings.TrimSuffix(f.Args, ")")
+	} else {
+		f.Func = funcLine
+	}
+	f.NormalizedArgs = normalizeArgs(f.Args, ptrIDs)
+	if m := frameLocationRE.FindStringSubmatch(locLine); m != nil {
+		f.File = m[1]
+		f.Line, _ = strconv.Atoi(m[2])
+	}
+	return f
+}
+
+// normalizeArgs replaces every pointer-looking token in raw (e.g.
+// "0xc0001a2000") with a "#<n>" placeholder, assigning ids in order of
+// first appearance and reusing them for values seen again. ptrIDs is
+// shared across an entire Parse call so the same pointer value always maps
+// to the same placeholder within one Snapshot.
+func normalizeArgs(raw string, ptrIDs map[string]int) string {
+	if raw == "" {
+		return raw
+	}
+	return pointerArgRE.ReplaceAllStringFunc(raw, func(tok string) string {
+		id, ok := ptrIDs[tok]
+		if !ok {
+			id = len(ptrIDs)
+			ptrIDs[tok] = id
+		}
+		return fmt.Sprintf("#%d", id)
+	})
+}
+
+// group deduplicates goroutines whose key() matches, bucketing wait
+// durations into the [min, max] range observed within the group. The
+// resulting groups are sorted by descending size, with groups made up
+// entirely of standard-library frames pushed to the bottom regardless of
+// size.
+func group(goroutines []Goroutine) []Group {
+	byKey := map[string]*Group{}
+	var order []string
+	for _, g := range goroutines {
+		k := g.key()
+		gr, ok := byKey[k]
+		if !ok {
+			gr = &Group{MinWait: g.Wait, MaxWait: g.Wait}
+			byKey[k] = gr
+			order = append(order, k)
+		}
+		gr.Goroutines = append(gr.Goroutines, g)
+		if g.Wait < gr.MinWait {
+			gr.MinWait = g.Wait
+		}
+		if g.Wait > gr.MaxWait {
+			gr.MaxWait = g.Wait
+		}
+	}
+
+	groups := make([]Group, 0, len(order))
+	for _, k := range order {
+		groups = append(groups, *byKey[k])
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		si, sj := groups[i].Goroutines[0].isStdlibOnly(), groups[j].Goroutines[0].isStdlibOnly()
+		if si != sj {
+			return !si
+		}
+		return len(groups[i].Goroutines) > len(groups[j].Goroutines)
+	})
+	return groups
+}
+
+// WriteText writes a human-readable, densified rendering of the snapshot to
+// w: one line per group, most populous (and non-stdlib) groups first.
+func (s *Snapshot) WriteText(w io.Writer) error {
+	for _, gr := range s.Groups {
+		if _, err := fmt.Fprintln(w, gr.Summary()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHTML writes the same information as WriteText as a minimal HTML
+// document with one <details> element per group, so an e2e debug HTTP
+// handler can serve a live, collapsible goroutine dump.
+func (s *Snapshot) WriteHTML(w io.Writer) error {
+	if _, err := io.WriteString(w, "<html><body>\n"); err != nil {
+		return err
+	}
+	for _, gr := range s.Groups {
+		fmt.Fprintf(w, "<details><summary>%s</summary><pre>\n", html.EscapeString(gr.Summary()))
+		for _, f := range gr.Goroutines[0].Frames {
+			args := f.NormalizedArgs
+			if args != "" {
+				args = "(" + args + ")"
+			}
+			fmt.Fprintf(w, "%s%s\n\t%s:%d\n", html.EscapeString(f.Func), html.EscapeString(args), html.EscapeString(f.File), f.Line)
+		}
+		if _, err := io.WriteString(w, "</pre></details>\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</body></html>\n")
+	return err
+}
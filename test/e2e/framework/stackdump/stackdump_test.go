@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stackdump
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleDump = `goroutine 1 [running]:
+k8s.io/kubernetes/test/e2e/framework.PrunedStack(0x0)
+	/go/src/k8s.io/kubernetes/test/e2e/framework/log.go:233 +0x123
+main.main()
+	/go/src/k8s.io/kubernetes/cmd/e2e.test/main.go:42 +0x45
+
+goroutine 7 [chan receive, 5 minutes]:
+k8s.io/kubernetes/test/e2e/framework.Eventually(0xc0001a2000, 0x2540be400)
+	/go/src/k8s.io/kubernetes/test/e2e/framework/expect.go:88 +0x67
+created by k8s.io/kubernetes/test/e2e.RunE2ETests
+	/go/src/k8s.io/kubernetes/test/e2e/e2e.go:100 +0x321
+
+goroutine 8 [chan receive, 12 minutes]:
+k8s.io/kubernetes/test/e2e/framework.Eventually(0xc0001a4000, 0x2540be400)
+	/go/src/k8s.io/kubernetes/test/e2e/framework/expect.go:88 +0x67
+created by k8s.io/kubernetes/test/e2e.RunE2ETests
+	/go/src/k8s.io/kubernetes/test/e2e/e2e.go:100 +0x321
+`
+
+func TestParseGroupsIdenticalStacks(t *testing.T) {
+	snapshot, err := Parse([]byte(sampleDump))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if len(snapshot.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d: %+v", len(snapshot.Groups), snapshot.Groups)
+	}
+
+	var eventuallyGroup *Group
+	for i := range snapshot.Groups {
+		if snapshot.Groups[i].Goroutines[0].State == "chan receive" {
+			eventuallyGroup = &snapshot.Groups[i]
+		}
+	}
+	if eventuallyGroup == nil {
+		t.Fatalf("expected a chan receive group, got %+v", snapshot.Groups)
+	}
+	if len(eventuallyGroup.Goroutines) != 2 {
+		t.Errorf("expected the two chan receive goroutines to be deduplicated into one group, got %d", len(eventuallyGroup.Goroutines))
+	}
+	if eventuallyGroup.MinWait.Minutes() != 5 || eventuallyGroup.MaxWait.Minutes() != 12 {
+		t.Errorf("expected wait range [5,12] minutes, got [%v,%v]", eventuallyGroup.MinWait, eventuallyGroup.MaxWait)
+	}
+}
+
+func TestSnapshotWriteText(t *testing.T) {
+	snapshot, err := Parse([]byte(sampleDump))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	var buf strings.Builder
+	if err := snapshot.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText returned error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2 goroutines") {
+		t.Errorf("expected the deduplicated group to be reported, got:\n%s", buf.String())
+	}
+}
+
+func TestIsStdlibFunc(t *testing.T) {
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"net/http.(*conn).serve", true},
+		{"encoding/json.Unmarshal", true},
+		{"runtime.Callers", true},
+		{"k8s.io/kubernetes/test/e2e/framework.PrunedStack", false},
+		{"github.com/onsi/ginkgo/v2.GinkgoT", false},
+		{"main.main", true},
+	}
+	for _, c := range cases {
+		if got := isStdlibFunc(c.name); got != c.want {
+			t.Errorf("isStdlibFunc(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNormalizeArgsStable(t *testing.T) {
+	ids := map[string]int{}
+	first := normalizeArgs("0xc0001a2000, 0x2540be400", ids)
+	second := normalizeArgs("0xc0001a4000, 0x2540be400", ids)
+	if first != "#0, #1" {
+		t.Errorf("first = %q, want %q", first, "#0, #1")
+	}
+	if second != "#2, #1" {
+		t.Errorf("second = %q, want %q (shared pointer value should reuse id #1)", second, "#2, #1")
+	}
+}